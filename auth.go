@@ -0,0 +1,32 @@
+package simplemail
+
+import (
+	"errors"
+	"net/smtp"
+)
+
+// loginAuth implements the LOGIN SASL mechanism, which net/smtp does not
+// provide directly. Some providers advertise AUTH LOGIN but not PLAIN, so
+// this is needed to interoperate with them.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	default:
+		return nil, errors.New("simplemail: unexpected LOGIN auth prompt: " + string(fromServer))
+	}
+}
@@ -0,0 +1,265 @@
+package simplemail
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SendCloser sends messages over an open SMTP session and closes the
+// session once the caller is done with it.
+type SendCloser interface {
+	Send(from string, to []string, msg io.WriterTo) error
+	Close() error
+}
+
+// Dialer holds the configuration needed to open, and transparently
+// re-open, an SMTP session. A *Dialer is safe to reuse across many calls
+// to Dial, which is the point: unlike (*Email).Send, a session opened via
+// Dial stays open across multiple messages instead of reconnecting for
+// each one.
+type Dialer struct {
+	Host      string
+	Port      string
+	Username  string
+	Password  string
+	TLSPolicy TLSPolicy
+	// TLSConfig is used when TLSPolicy is not NoTLS. If nil, a config
+	// with ServerName set to Host is used.
+	TLSConfig *tls.Config
+	// AuthType selects the SASL mechanism used when Username is set. It
+	// defaults to AuthPlain, like Email.AuthType.
+	AuthType AuthType
+	// Timeout bounds each dial. Zero means no timeout.
+	Timeout time.Duration
+	// LocalName is used as the client name in the EHLO/HELO greeting. If
+	// empty, "localhost" is used.
+	LocalName string
+	// MaxRetries bounds how many times Send attempts to deliver a message,
+	// redialing before each attempt after the first. Zero means 2: the
+	// original attempt plus one redial-and-retry, so the Dialer built by
+	// (*Email).Send, which leaves MaxRetries at zero, still reconnects once
+	// on a broken connection
+	// instead of silently giving up.
+	MaxRetries int
+}
+
+// Dial opens an SMTP session to Host:Port, securing and authenticating it
+// per TLSPolicy/AuthType, and returns a SendCloser that keeps the session
+// open across multiple calls to Send.
+func (d *Dialer) Dial() (SendCloser, error) {
+	c, err := d.newClient()
+	if err != nil {
+		return nil, err
+	}
+	return &smtpSender{dialer: d, client: c}, nil
+}
+
+func (d *Dialer) dialConn() (net.Conn, error) {
+	addr := d.Host + ":" + d.Port
+	if d.TLSPolicy == ImplicitTLS {
+		if d.Timeout <= 0 {
+			return tls.Dial("tcp", addr, d.tlsConfig())
+		}
+		conn, err := net.DialTimeout("tcp", addr, d.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		tconn := tls.Client(conn, d.tlsConfig())
+		if err := tconn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tconn, nil
+	}
+	if d.Timeout <= 0 {
+		return net.Dial("tcp", addr)
+	}
+	return net.DialTimeout("tcp", addr, d.Timeout)
+}
+
+func (d *Dialer) tlsConfig() *tls.Config {
+	if d.TLSConfig != nil {
+		return d.TLSConfig
+	}
+	return &tls.Config{ServerName: d.Host}
+}
+
+func (d *Dialer) smtpAuth() (smtp.Auth, error) {
+	switch d.AuthType {
+	case AuthPlain:
+		return smtp.PlainAuth("", d.Username, d.Password, d.Host), nil
+	case AuthLogin:
+		return &loginAuth{username: d.Username, password: d.Password}, nil
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(d.Username, d.Password), nil
+	default:
+		return nil, fmt.Errorf("simplemail: unsupported AuthType %d", d.AuthType)
+	}
+}
+
+// newClient dials a fresh connection and brings it up to the point of
+// being ready to send: greeted, STARTTLS negotiated if applicable, and
+// authenticated if Username is set.
+func (d *Dialer) newClient() (*smtp.Client, error) {
+	conn, err := d.dialConn()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, d.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	localName := d.LocalName
+	if localName == "" {
+		localName = "localhost"
+	}
+	if err := c.Hello(localName); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if d.TLSPolicy == STARTTLSOpportunistic || d.TLSPolicy == STARTTLSMandatory {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(d.tlsConfig()); err != nil {
+				c.Close()
+				return nil, err
+			}
+		} else if d.TLSPolicy == STARTTLSMandatory {
+			c.Close()
+			return nil, fmt.Errorf("simplemail: server %s does not support STARTTLS", d.Host)
+		}
+	}
+
+	if d.Username != "" && d.AuthType != AuthNone {
+		if mech := authMechanismName(d.AuthType); mech != "" {
+			if ok, params := c.Extension("AUTH"); ok && !authMechanismAdvertised(params, mech) {
+				c.Close()
+				return nil, fmt.Errorf("simplemail: server %s does not advertise AUTH %s (advertises: %s)", d.Host, mech, params)
+			}
+		}
+
+		auth, err := d.smtpAuth()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// authMechanismName returns the AUTH mechanism name a server would
+// advertise for t, or "" if t doesn't correspond to one (e.g. AuthNone).
+func authMechanismName(t AuthType) string {
+	switch t {
+	case AuthPlain:
+		return "PLAIN"
+	case AuthLogin:
+		return "LOGIN"
+	case AuthCRAMMD5:
+		return "CRAM-MD5"
+	default:
+		return ""
+	}
+}
+
+// authMechanismAdvertised reports whether mech appears in params, the
+// space-separated mechanism list from the server's AUTH extension.
+func authMechanismAdvertised(params, mech string) bool {
+	for _, m := range strings.Fields(params) {
+		if strings.EqualFold(m, mech) {
+			return true
+		}
+	}
+	return false
+}
+
+// smtpSender implements SendCloser over a single, reused *smtp.Client,
+// transparently redialing when the connection turns out to be broken.
+type smtpSender struct {
+	dialer *Dialer
+	client *smtp.Client
+}
+
+// Send delivers msg from from to every address in to. If the session turns
+// out to be broken (e.g. the server closed an idle connection), Send
+// redials and retries, making at most dialer.MaxRetries attempts in all.
+func (s *smtpSender) Send(from string, to []string, msg io.WriterTo) error {
+	maxRetries := s.dialer.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = 2
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 {
+			c, err := s.dialer.newClient()
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			s.client.Close()
+			s.client = c
+		}
+
+		err := s.send(from, to, msg)
+		if err == nil {
+			return nil
+		}
+		if !isRetryableSendErr(err) {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+func (s *smtpSender) send(from string, to []string, msg io.WriterTo) error {
+	if err := s.client.Mail(from); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err := s.client.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := s.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := msg.WriteTo(w); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Close terminates the SMTP session gracefully.
+func (s *smtpSender) Close() error {
+	return s.client.Quit()
+}
+
+// isRetryableSendErr reports whether err looks like a broken connection,
+// as opposed to a permanent protocol or server rejection, and is therefore
+// worth retrying against a freshly dialed connection.
+func isRetryableSendErr(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
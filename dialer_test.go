@@ -0,0 +1,236 @@
+package simplemail
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// scriptedSMTPServer is a minimal SMTP server for exercising Dialer/
+// smtpSender against real TCP connections: each accepted connection is
+// handed to handle, which is responsible for writing its own greeting and
+// responses.
+type scriptedSMTPServer struct {
+	ln net.Listener
+}
+
+func newScriptedSMTPServer(t *testing.T, handle func(conn net.Conn)) *scriptedSMTPServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	s := &scriptedSMTPServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *scriptedSMTPServer) hostPort() (string, string) {
+	host, port, _ := net.SplitHostPort(s.ln.Addr().String())
+	return host, port
+}
+
+func (s *scriptedSMTPServer) close() {
+	s.ln.Close()
+}
+
+// TestSendRedialsAfterBrokenConnection verifies that a Dialer with
+// MaxRetries left at zero (as (*Email).Send builds it) actually redials and
+// retries once
+// when the server drops the connection mid-session, rather than returning
+// the first retryable error.
+func TestSendRedialsAfterBrokenConnection(t *testing.T) {
+	var conns int32
+
+	srv := newScriptedSMTPServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		n := atomic.AddInt32(&conns, 1)
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch strings.ToUpper(fields[0]) {
+			case "EHLO":
+				fmt.Fprint(conn, "250-localhost\r\n250 OK\r\n")
+			case "MAIL":
+				if n == 1 {
+					// Simulate the first connection dying mid-session.
+					return
+				}
+				fmt.Fprint(conn, "250 OK\r\n")
+			case "RCPT":
+				fmt.Fprint(conn, "250 OK\r\n")
+			case "DATA":
+				fmt.Fprint(conn, "354 send data\r\n")
+				for {
+					dl, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dl == ".\r\n" {
+						break
+					}
+				}
+				fmt.Fprint(conn, "250 OK\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "502 unrecognized\r\n")
+			}
+		}
+	})
+	defer srv.close()
+
+	host, port := srv.hostPort()
+	d := &Dialer{Host: host, Port: port}
+	sc, err := d.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer sc.Close()
+
+	em := NewEmail()
+	em.From = "sender@example.com"
+	em.To = []string{"recipient@example.com"}
+	em.Body = "hi"
+
+	if err := sc.Send(em.From, em.To, em); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if got := atomic.LoadInt32(&conns); got < 2 {
+		t.Errorf("connections opened = %d, want >= 2 (Send should have redialed)", got)
+	}
+}
+
+// newEHLOServer returns a scripted server that greets, answers EHLO with
+// "250-localhost" plus one continuation line per entry in ext, and hands
+// off to handleAuth (if non-nil) when the client sends an AUTH command.
+func newEHLOServer(t *testing.T, ext []string, handleAuth func(conn net.Conn, line []string) bool) *scriptedSMTPServer {
+	return newScriptedSMTPServer(t, func(conn net.Conn) {
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 localhost ESMTP\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			switch strings.ToUpper(fields[0]) {
+			case "EHLO":
+				if len(ext) == 0 {
+					fmt.Fprint(conn, "250 localhost\r\n")
+					continue
+				}
+				fmt.Fprint(conn, "250-localhost\r\n")
+				for i, e := range ext {
+					if i == len(ext)-1 {
+						fmt.Fprint(conn, "250 "+e+"\r\n")
+						continue
+					}
+					fmt.Fprint(conn, "250-"+e+"\r\n")
+				}
+			case "AUTH":
+				if handleAuth != nil && handleAuth(conn, fields) {
+					continue
+				}
+				fmt.Fprint(conn, "535 authentication failed\r\n")
+				return
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			default:
+				fmt.Fprint(conn, "502 unrecognized\r\n")
+				return
+			}
+		}
+	})
+}
+
+// TestDialSTARTTLSMandatoryFailsWithoutSupport verifies that a Dialer with
+// TLSPolicy STARTTLSMandatory refuses to proceed against a server that
+// doesn't advertise STARTTLS, instead of silently sending credentials (or
+// mail) over plaintext.
+func TestDialSTARTTLSMandatoryFailsWithoutSupport(t *testing.T) {
+	srv := newEHLOServer(t, nil, nil)
+	defer srv.close()
+
+	host, port := srv.hostPort()
+	d := &Dialer{Host: host, Port: port, TLSPolicy: STARTTLSMandatory}
+
+	_, err := d.Dial()
+	if err == nil {
+		t.Fatal("Dial: got nil error, want one reporting missing STARTTLS support")
+	}
+	if !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("Dial error = %q, want it to mention STARTTLS", err.Error())
+	}
+}
+
+// TestDialAuthMechanismMismatch verifies that newClient refuses to
+// authenticate when the server's advertised AUTH mechanisms don't include
+// the one AuthType selects, rather than attempting it anyway.
+func TestDialAuthMechanismMismatch(t *testing.T) {
+	srv := newEHLOServer(t, []string{"AUTH LOGIN"}, func(conn net.Conn, fields []string) bool {
+		t.Fatal("server received an AUTH command; Dial should have rejected the mechanism mismatch first")
+		return false
+	})
+	defer srv.close()
+
+	host, port := srv.hostPort()
+	d := &Dialer{Host: host, Port: port, Username: "user", Password: "pass", AuthType: AuthPlain}
+
+	_, err := d.Dial()
+	if err == nil {
+		t.Fatal("Dial: got nil error, want one reporting the AUTH mechanism mismatch")
+	}
+	if !strings.Contains(err.Error(), "AUTH PLAIN") {
+		t.Errorf("Dial error = %q, want it to mention AUTH PLAIN", err.Error())
+	}
+}
+
+// TestDialAuthSucceedsWhenMechanismAdvertised verifies that newClient
+// completes AUTH PLAIN against a server that does advertise it.
+func TestDialAuthSucceedsWhenMechanismAdvertised(t *testing.T) {
+	srv := newEHLOServer(t, []string{"AUTH PLAIN"}, func(conn net.Conn, fields []string) bool {
+		if len(fields) < 2 || strings.ToUpper(fields[1]) != "PLAIN" {
+			fmt.Fprint(conn, "504 unrecognized auth type\r\n")
+			return true
+		}
+		fmt.Fprint(conn, "235 2.7.0 Authentication successful\r\n")
+		return true
+	})
+	defer srv.close()
+
+	host, port := srv.hostPort()
+	d := &Dialer{Host: host, Port: port, Username: "user", Password: "pass", AuthType: AuthPlain}
+
+	sc, err := d.Dial()
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	if err := sc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package simplemail
+
+import (
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// maxHeaderLineLen is the line length header folding wraps before, per
+// RFC 5322 section 2.1.1's recommended 78-column limit (kept a couple of
+// characters under to leave room for the trailing CRLF).
+const maxHeaderLineLen = 76
+
+// encodeHeaderValue encodes v as an RFC 2047 encoded-word using
+// mime.BEncoding if it contains non-ASCII bytes; otherwise v is returned
+// unchanged.
+func encodeHeaderValue(v string) string {
+	if isASCII(v) {
+		return v
+	}
+	return mime.BEncoding.Encode("UTF-8", v)
+}
+
+// foldHeader renders "name: value" as one or more CRLF-terminated lines,
+// folding before maxHeaderLineLen by breaking on spaces and continuing each
+// subsequent line with a leading space, per RFC 5322 section 2.2.3.
+func foldHeader(name, value string) string {
+	line := name + ": " + value
+	if len(line) <= maxHeaderLineLen {
+		return line + "\r\n"
+	}
+
+	var b strings.Builder
+	cur := name + ":"
+	for _, word := range strings.Split(value, " ") {
+		candidate := cur + " " + word
+		if len(candidate) > maxHeaderLineLen {
+			b.WriteString(cur)
+			b.WriteString("\r\n")
+			cur = " " + word
+			continue
+		}
+		cur = candidate
+	}
+	b.WriteString(cur)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// encodeQuotedPrintable returns s encoded as quoted-printable, soft-wrapped
+// per RFC 2045's 76-character line limit.
+func encodeQuotedPrintable(s string) string {
+	var b strings.Builder
+	w := quotedprintable.NewWriter(&b)
+	w.Write([]byte(s))
+	w.Close()
+	return b.String()
+}
+
+// encodeFileNameParam renders a Content-Type/Content-Disposition parameter
+// such as name="report.txt", switching to the RFC 2231 extended form
+// (name*=UTF-8''...) when name contains non-ASCII characters.
+func encodeFileNameParam(param, name string) string {
+	if isASCII(name) {
+		return fmt.Sprintf(`%s="%s"`, param, name)
+	}
+	return fmt.Sprintf("%s*=UTF-8''%s", param, rfc2231Encode(name))
+}
+
+// rfc2231Encode percent-encodes s per RFC 2231's attribute-char grammar.
+func rfc2231Encode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isRFC2231Safe(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isRFC2231Safe(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case c == '-' || c == '.' || c == '_' || c == '~':
+		return true
+	}
+	return false
+}
+
+// isASCII reports whether s contains only 7-bit bytes.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 127 {
+			return false
+		}
+	}
+	return true
+}
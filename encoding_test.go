@@ -0,0 +1,181 @@
+package simplemail
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestFoldHeaderRespectsLineLimit(t *testing.T) {
+	long := strings.Repeat("word ", 40)
+	folded := foldHeader("Subject", long)
+	for _, line := range strings.Split(strings.TrimRight(folded, "\r\n"), "\r\n") {
+		if len(line) > maxHeaderLineLen {
+			t.Errorf("line %q is %d chars, want <= %d", line, len(line), maxHeaderLineLen)
+		}
+	}
+}
+
+func TestFoldHeaderLongEncodedWordFirstLine(t *testing.T) {
+	// A long non-ASCII subject is chunked by mime.BEncoding into multiple
+	// encoded-words; "Subject: " plus the first one alone can already
+	// exceed the fold limit.
+	subject := strings.Repeat("é", 80)
+	encoded := encodeHeaderValue(subject)
+	folded := foldHeader("Subject", encoded)
+
+	for _, line := range strings.Split(strings.TrimRight(folded, "\r\n"), "\r\n") {
+		if len(line) > maxHeaderLineLen {
+			t.Errorf("line %q is %d chars, want <= %d", line, len(line), maxHeaderLineLen)
+		}
+	}
+
+	decoded, err := new(mime.WordDecoder).DecodeHeader(strings.ReplaceAll(strings.TrimRight(folded, "\r\n"), "\r\n ", " "))
+	if err != nil {
+		t.Fatalf("DecodeHeader: %v", err)
+	}
+	want := "Subject: " + subject
+	if decoded != want {
+		t.Errorf("decoded = %q, want %q", decoded, want)
+	}
+}
+
+func TestStringOutputFlatBodyParsesAsMIME(t *testing.T) {
+	em := NewEmail()
+	em.From = "sender@example.com"
+	em.To = []string{"recipient@example.com"}
+	em.Subject = "Plain only"
+	em.Body = "just a plain body"
+
+	raw := em.String()
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+	if mediaType != "text/plain" {
+		t.Fatalf("mediaType = %q, want text/plain", mediaType)
+	}
+	if params["charset"] != em.Charset {
+		t.Errorf("charset = %q, want %q", params["charset"], em.Charset)
+	}
+
+	contents, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if got := strings.TrimRight(string(contents), "\r\n"); got != em.Body {
+		t.Errorf("body = %q, want %q", got, em.Body)
+	}
+}
+
+func TestStringOutputFlatHTMLParsesAsMIME(t *testing.T) {
+	em := NewEmail()
+	em.From = "sender@example.com"
+	em.To = []string{"recipient@example.com"}
+	em.Subject = "HTML only"
+	em.HTMLBody = "<p>just an html body</p>"
+
+	raw := em.String()
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+	if mediaType != "text/html" {
+		t.Fatalf("mediaType = %q, want text/html", mediaType)
+	}
+	if params["charset"] != em.Charset {
+		t.Errorf("charset = %q, want %q", params["charset"], em.Charset)
+	}
+
+	contents, err := ioutil.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if got := strings.TrimRight(string(contents), "\r\n"); got != em.HTMLBody {
+		t.Errorf("body = %q, want %q", got, em.HTMLBody)
+	}
+
+	// msg.Header must contain exactly one Content-Type value; a parser
+	// that concatenates repeated headers (unlike net/mail's "first wins")
+	// would otherwise surface the duplicate-header regression directly.
+	if n := len(msg.Header["Content-Type"]); n != 1 {
+		t.Errorf("len(Content-Type headers) = %d, want 1", n)
+	}
+}
+
+func TestStringOutputParsesAsMIME(t *testing.T) {
+	em := NewEmail()
+	em.From = "sender@example.com"
+	em.FromName = "Sénder Nâme"
+	em.To = []string{"recipient@example.com"}
+	em.Subject = "Très bien, ça marche"
+	em.Body = "plain body with café"
+	em.HTMLBody = "<p>html body with café</p>"
+
+	raw := em.String()
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage: %v", err)
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("DecodeHeader(Subject): %v", err)
+	}
+	if subject != em.Subject {
+		t.Errorf("Subject = %q, want %q", subject, em.Subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("ParseMediaType: %v", err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("mediaType = %q, want multipart/alternative", mediaType)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var sawPlain, sawHTML bool
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		contents, err := ioutil.ReadAll(p)
+		if err != nil {
+			t.Fatalf("reading part: %v", err)
+		}
+		switch {
+		case strings.HasPrefix(p.Header.Get("Content-Type"), "text/plain"):
+			sawPlain = true
+			if !strings.Contains(string(contents), "caf") {
+				t.Errorf("plain part missing expected content: %q", contents)
+			}
+		case strings.HasPrefix(p.Header.Get("Content-Type"), "text/html"):
+			sawHTML = true
+			if !strings.Contains(string(contents), "caf") {
+				t.Errorf("html part missing expected content: %q", contents)
+			}
+		}
+	}
+	if !sawPlain || !sawHTML {
+		t.Errorf("expected both plain and html parts, got plain=%v html=%v", sawPlain, sawHTML)
+	}
+}
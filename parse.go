@@ -0,0 +1,215 @@
+package simplemail
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+)
+
+// ParseEML reads a raw RFC 5322 / MIME message from r and returns a
+// hydrated *Email. From/To/Cc/Reply-To/Subject/Date/Message-ID headers are
+// decoded (including RFC 2047 encoded-words), and multipart/alternative,
+// multipart/mixed, and multipart/related bodies are walked to populate
+// Body, HTMLBody, and Attachments.
+func ParseEML(r io.Reader) (*Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	em := NewEmail()
+	dec := new(mime.WordDecoder)
+
+	if from := msg.Header.Get("From"); from != "" {
+		if addr, err := mail.ParseAddress(from); err == nil {
+			em.From = addr.Address
+			em.FromName = decodeOrSelf(dec, addr.Name)
+		} else {
+			em.From = from
+		}
+	}
+	em.Sender = headerAddress(msg.Header.Get("Sender"))
+	em.To = parseAddressList(msg.Header.Get("To"))
+	em.CC = parseAddressList(msg.Header.Get("Cc"))
+	em.ReplyTo = parseAddressList(msg.Header.Get("Reply-To"))
+	em.Subject = decodeOrSelf(dec, msg.Header.Get("Subject"))
+
+	if d, err := msg.Header.Date(); err == nil {
+		em.Date = d
+	}
+	em.MessageID = strings.Trim(msg.Header.Get("Message-Id"), "<>")
+	em.XTraceID = msg.Header.Get("X-Nstraceid")
+	em.XPriority = msg.Header.Get("X-Priority")
+	em.XMSMailPriority = msg.Header.Get("X-Msmail-Priority")
+	em.Importance = msg.Header.Get("Importance")
+
+	ct := msg.Header.Get("Content-Type")
+	if ct == "" {
+		body, err := ioutil.ReadAll(msg.Body)
+		if err != nil {
+			return nil, err
+		}
+		em.Body = string(body)
+		return em, nil
+	}
+
+	if err := em.parseBodyPart(textproto.MIMEHeader(msg.Header), msg.Body); err != nil {
+		return nil, err
+	}
+
+	return em, nil
+}
+
+// ParseEMLFile reads and parses the EML message stored at path.
+func ParseEMLFile(path string) (*Email, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseEML(f)
+}
+
+// ParseEMLString parses the EML message contained in s.
+func ParseEMLString(s string) (*Email, error) {
+	return ParseEML(strings.NewReader(s))
+}
+
+// parseBodyPart decodes a single MIME part described by header/r, recursing
+// into nested multipart parts and otherwise filling in em.Body, em.HTMLBody,
+// or appending to em.Attachments as appropriate.
+func (em *Email) parseBodyPart(header textproto.MIMEHeader, r io.Reader) error {
+	mediaType := "text/plain"
+	params := map[string]string{}
+	if ct := header.Get("Content-Type"); ct != "" {
+		if mt, p, err := mime.ParseMediaType(ct); err == nil {
+			mediaType = mt
+			params = p
+		}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := em.parseBodyPart(p.Header, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	raw, err := decodeTransferEncoding(r, header.Get("Content-Transfer-Encoding"))
+	if err != nil {
+		return err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	dec := new(mime.WordDecoder)
+	fileName := dparams["filename"]
+	if fileName == "" {
+		fileName = params["name"]
+	}
+	fileName = decodeOrSelf(dec, fileName)
+	contentID := strings.Trim(header.Get("Content-Id"), "<>")
+
+	isAttachment := disposition == "attachment" || contentID != "" || fileName != ""
+
+	switch {
+	case !isAttachment && mediaType == "text/html" && em.HTMLBody == "":
+		em.HTMLBody = string(raw)
+	case !isAttachment && em.Body == "":
+		em.Body = string(raw)
+	default:
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		em.Attachments = append(em.Attachments, &Attachment{
+			ContentType:        mediaType,
+			ContentDisposition: disposition,
+			ContentID:          contentID,
+			FileName:           fileName,
+			Contents:           raw,
+		})
+	}
+	return nil
+}
+
+// decodeTransferEncoding applies the Content-Transfer-Encoding named by cte
+// (base64, quoted-printable, or anything else treated as identity) and
+// returns the decoded bytes.
+func decodeTransferEncoding(r io.Reader, cte string) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(cte)) {
+	case "base64":
+		return ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, r))
+	case "quoted-printable":
+		return ioutil.ReadAll(quotedprintable.NewReader(r))
+	default:
+		return ioutil.ReadAll(r)
+	}
+}
+
+// parseAddressList decodes a comma-separated address-list header into the
+// plain strings this package's To/CC/ReplyTo fields expect.
+func parseAddressList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	addrs, err := mail.ParseAddressList(v)
+	if err != nil {
+		var res []string
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				res = append(res, p)
+			}
+		}
+		return res
+	}
+	res := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if a.Name != "" {
+			res = append(res, fmt.Sprintf("%q <%s>", a.Name, a.Address))
+		} else {
+			res = append(res, a.Address)
+		}
+	}
+	return res
+}
+
+// headerAddress extracts the bare address from a single address header such
+// as Sender.
+func headerAddress(v string) string {
+	if v == "" {
+		return ""
+	}
+	if addr, err := mail.ParseAddress(v); err == nil {
+		return addr.Address
+	}
+	return v
+}
+
+// decodeOrSelf runs an RFC 2047 decode over v, falling back to v unchanged
+// if it isn't encoded-word text (or decoding otherwise fails).
+func decodeOrSelf(dec *mime.WordDecoder, v string) string {
+	if v == "" {
+		return v
+	}
+	if decoded, err := dec.DecodeHeader(v); err == nil {
+		return decoded
+	}
+	return v
+}
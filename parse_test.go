@@ -0,0 +1,97 @@
+package simplemail
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseEMLRoundTrip(t *testing.T) {
+	em := NewEmail()
+	em.From = "sender@example.com"
+	em.FromName = "Sender"
+	em.To = []string{"recipient@example.com"}
+	em.Subject = "Round trip"
+	em.Body = "hello there"
+	em.HTMLBody = "<p>hello there</p>"
+
+	parsed, err := ParseEMLString(em.String())
+	if err != nil {
+		t.Fatalf("ParseEMLString: %v", err)
+	}
+	if parsed.From != em.From {
+		t.Errorf("From = %q, want %q", parsed.From, em.From)
+	}
+	if len(parsed.To) != 1 || parsed.To[0] != em.To[0] {
+		t.Errorf("To = %v, want %v", parsed.To, em.To)
+	}
+	if parsed.Subject != em.Subject {
+		t.Errorf("Subject = %q, want %q", parsed.Subject, em.Subject)
+	}
+	if got := strings.TrimRight(parsed.Body, "\r\n"); got != em.Body {
+		t.Errorf("Body = %q, want %q", got, em.Body)
+	}
+	if got := strings.TrimRight(parsed.HTMLBody, "\r\n"); got != em.HTMLBody {
+		t.Errorf("HTMLBody = %q, want %q", got, em.HTMLBody)
+	}
+}
+
+func TestParseEMLRoundTripWithInlineAndAttachment(t *testing.T) {
+	img, err := ioutil.TempFile("", "simplemail-img-*.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(img.Name())
+	imgContents := []byte{0x89, 'P', 'N', 'G', 0, 1, 2, 3}
+	if _, err := img.Write(imgContents); err != nil {
+		t.Fatal(err)
+	}
+	img.Close()
+
+	em := NewEmail()
+	em.From = "sender@example.com"
+	em.To = []string{"recipient@example.com"}
+	em.Subject = "Round trip with attachments"
+	em.Body = "hello there"
+	em.HTMLBody = "<p>hello there</p><img src=\"cid:inline.png\">"
+
+	inline, err := em.EmbedFile(img.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	inline.ContentID = "inline.png"
+
+	if _, err := em.AttachFile(img.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := ParseEMLString(em.String())
+	if err != nil {
+		t.Fatalf("ParseEMLString: %v", err)
+	}
+	if got := strings.TrimRight(parsed.Body, "\r\n"); got != em.Body {
+		t.Errorf("Body = %q, want %q", got, em.Body)
+	}
+	if got := strings.TrimRight(parsed.HTMLBody, "\r\n"); got != em.HTMLBody {
+		t.Errorf("HTMLBody = %q, want %q", got, em.HTMLBody)
+	}
+	if len(parsed.Attachments) != 2 {
+		t.Fatalf("len(Attachments) = %d, want 2", len(parsed.Attachments))
+	}
+
+	var sawInline, sawRegular bool
+	for _, a := range parsed.Attachments {
+		if !strings.EqualFold(string(a.Contents), string(imgContents)) {
+			t.Errorf("attachment Contents = %x, want %x", a.Contents, imgContents)
+		}
+		if a.isInline() {
+			sawInline = true
+		} else {
+			sawRegular = true
+		}
+	}
+	if !sawInline || !sawRegular {
+		t.Errorf("expected one inline and one regular attachment, got inline=%v regular=%v", sawInline, sawRegular)
+	}
+}
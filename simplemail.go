@@ -3,11 +3,14 @@
 package simplemail
 
 import (
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"math/rand"
-	"net/smtp"
+	"net/http"
 	"strings"
 	"time"
 )
@@ -18,6 +21,43 @@ type Mailer interface {
 	Send() error
 }
 
+// TLSPolicy controls how (*Email).Send secures its connection to the SMTP
+// server.
+type TLSPolicy int
+
+const (
+	// NoTLS sends the message over a plaintext connection. This is the
+	// zero value, preserving the historical behavior of this package.
+	NoTLS TLSPolicy = iota
+	// STARTTLSOpportunistic upgrades the connection via STARTTLS if the
+	// server advertises support for it, but proceeds in plaintext if it
+	// does not.
+	STARTTLSOpportunistic
+	// STARTTLSMandatory upgrades the connection via STARTTLS and fails if
+	// the server does not advertise support for it.
+	STARTTLSMandatory
+	// ImplicitTLS dials the server over TLS from the first byte, as is
+	// conventional on port 465.
+	ImplicitTLS
+)
+
+// AuthType selects the SASL mechanism used to authenticate with the SMTP
+// server once connected. It is only consulted when Username is non-empty.
+type AuthType int
+
+const (
+	// AuthPlain uses smtp.PlainAuth. This is the zero value, preserving
+	// the historical behavior of this package.
+	AuthPlain AuthType = iota
+	// AuthLogin performs a LOGIN auth exchange, as required by some
+	// providers that don't advertise or accept PLAIN.
+	AuthLogin
+	// AuthCRAMMD5 uses smtp.CRAMMD5Auth.
+	AuthCRAMMD5
+	// AuthNone skips authentication even if Username is set.
+	AuthNone
+)
+
 // The Email object is the primary object of this package.  Fill out the fields // as needed, then call (*Email).Send to send it.  You should generally fill
 // out at least From, To, and Body.  For HTML emails, simply populate the
 // HTMLBody field.
@@ -47,6 +87,22 @@ type Email struct {
 	XMSMailPriority string
 	Importance      string
 	XTraceID        string
+	// Date is used as the Date header if non-zero; otherwise Send/String
+	// use time.Now().
+	Date time.Time
+	// MessageID, if set, is used as-is (without angle brackets) for the
+	// Message-ID header instead of auto-generating one from GenID and
+	// HostName.
+	MessageID string
+	// TLSPolicy controls whether and how the connection to Server is
+	// secured. It defaults to NoTLS for backwards compatibility.
+	TLSPolicy TLSPolicy
+	// TLSConfig is used when TLSPolicy is not NoTLS. If nil, a config
+	// with ServerName set to Server is used.
+	TLSConfig *tls.Config
+	// AuthType selects the SASL mechanism used when Username is set. It
+	// defaults to AuthPlain for backwards compatibility.
+	AuthType AuthType
 }
 
 // An Attachment object represents all fields needed for an email attachment.
@@ -70,7 +126,7 @@ func (a *Attachment) String() string {
 	}
 	s := fmt.Sprintf("Content-Type: %s", a.ContentType)
 	if a.FileName != "" {
-		s += fmt.Sprintf(`; name="%s"`, a.FileName)
+		s += "; " + encodeFileNameParam("name", a.FileName)
 	}
 	s += "\r\n"
 	if a.ContentID != "" {
@@ -78,33 +134,41 @@ func (a *Attachment) String() string {
 	}
 	s += fmt.Sprintf("Content-Disposition: %s; size=%d", a.ContentDisposition, len(a.Contents))
 	if a.FileName != "" {
-		s += `; filename="` + a.FileName + `"`
-		s += "\r\nContent-Description: " + a.FileName
+		s += "; " + encodeFileNameParam("filename", a.FileName)
+		s += "\r\nContent-Description: " + encodeHeaderValue(a.FileName)
 	}
 	s += "\r\nContent-Transfer-Encoding: base64\r\n\r\n"
 	s += base64.StdEncoding.EncodeToString(a.Contents) + "\r\n\r\n"
 	return s
 }
 
-func genBoundary() string {
-	all := "0123456789abcdef"
-	res := ""
-	rand.Seed(time.Now().UnixNano())
-	for i := 0; i < 35; i++ {
-		res += string(all[rand.Intn(len(all))])
+// isInline reports whether a should be embedded in a multipart/related tree
+// and referenced from HTML via a "cid:" URL, rather than listed as a
+// regular attachment.
+func (a *Attachment) isInline() bool {
+	return a.ContentDisposition == "inline" && a.ContentID != ""
+}
+
+// randomHex returns n hex digits read from crypto/rand, safe for
+// concurrent use by multiple goroutines.
+func randomHex(n int) string {
+	buf := make([]byte, (n+1)/2)
+	if _, err := rand.Read(buf); err != nil {
+		panic("simplemail: failed to read random bytes: " + err.Error())
 	}
-	return res
+	return hex.EncodeToString(buf)[:n]
+}
+
+// genBoundary returns a 35-character (140-bit) boundary built from the
+// RFC 2046 bchars grammar, making accidental collision with body content
+// effectively impossible.
+func genBoundary() string {
+	return randomHex(35)
 }
 
-// GenID returns a random email ID.
+// GenID returns a random, 128-bit email ID.
 func GenID() string {
-	all := "0123456789ABCDEF"
-	res := ""
-	rand.Seed(time.Now().UnixNano())
-	for i := 0; i < 32; i++ {
-		res += string(all[rand.Intn(len(all))])
-	}
-	return res
+	return strings.ToUpper(randomHex(32))
 }
 
 // NewEmail returns a new *Email object with default Port 25 and Charset UTF-8.
@@ -134,8 +198,15 @@ func (em *Email) generateBody(boundary string) string {
 
 	m := `Content-Type: text/plain; charset="` + em.Charset + `"` + "\r\n"
 	m += "MIME-Version: 1.0\r\n"
-	m += "\r\n"
-	m += em.Body + "\r\n\r\n"
+	if isASCII(em.Body) {
+		m += "Content-Transfer-Encoding: 7bit\r\n"
+		m += "\r\n"
+		m += em.Body + "\r\n\r\n"
+	} else {
+		m += "Content-Transfer-Encoding: quoted-printable\r\n"
+		m += "\r\n"
+		m += encodeQuotedPrintable(em.Body) + "\r\n\r\n"
+	}
 	if boundary != "" {
 		m += "--" + boundary + "\r\n"
 	}
@@ -148,9 +219,15 @@ func (em *Email) generateHTML(boundary string) string {
 	}
 	m := `Content-Type: text/html; charset="` + em.Charset + `"` + "\r\n"
 	m += "MIME-Version: 1.0\r\n"
-	m += "Content-Transfer-Encoding: base64\r\n"
-	m += "\r\n"
-	m += base64.StdEncoding.EncodeToString([]byte(em.HTMLBody)) + "\r\n\r\n"
+	if isASCII(em.HTMLBody) {
+		m += "Content-Transfer-Encoding: 7bit\r\n"
+		m += "\r\n"
+		m += em.HTMLBody + "\r\n\r\n"
+	} else {
+		m += "Content-Transfer-Encoding: quoted-printable\r\n"
+		m += "\r\n"
+		m += encodeQuotedPrintable(em.HTMLBody) + "\r\n\r\n"
+	}
 	if boundary != "" {
 		m += "--" + boundary + "\r\n"
 	}
@@ -158,15 +235,40 @@ func (em *Email) generateHTML(boundary string) string {
 	return m
 }
 
-func (em *Email) generateAttachments(boundary string) string {
+func (em *Email) generateAttachments(boundary string, attachments []*Attachment) string {
 	m := ""
-	for _, e := range em.Attachments {
+	for _, e := range attachments {
 		m += e.String()
 		m += "--" + boundary + "\r\n"
 	}
 	return m
 }
 
+// generateHTMLPart returns the rendered text/html part, the same as
+// generateHTML, except that when em.Attachments contains inline resources
+// it wraps the HTML part and those resources in their own multipart/related
+// boundary so HTMLBody may reference them via "cid:" URLs. Like
+// generateBody/generateHTML, the result ends with a trailing boundary
+// marker for boundary.
+func (em *Email) generateHTMLPart(boundary string) string {
+	inline := em.inlineAttachments()
+	if em.HTMLBody == "" || len(inline) == 0 {
+		return em.generateHTML(boundary)
+	}
+
+	relBoundary := genBoundary()
+	m := fmt.Sprintf("Content-Type: multipart/related; boundary=\"%s\"\r\n", relBoundary)
+	m += "MIME-Version: 1.0\r\n\r\n"
+	m += "--" + relBoundary + "\r\n"
+	m += em.generateHTML(relBoundary)
+	m += em.generateAttachments(relBoundary, inline)
+	m = strings.TrimRight(m, "\r\n") + "--\r\n\r\n"
+	if boundary != "" {
+		m += "--" + boundary + "\r\n"
+	}
+	return m
+}
+
 // AttachFile creates an *Attachment object filling out the Contents and
 // FileName fields and adds it to the Attachments list.  It also
 // returns the *Attachment so that the user may set additional fields.
@@ -183,24 +285,78 @@ func (em *Email) AttachFile(fileName string) (*Attachment, error) {
 	return att, nil
 }
 
+// EmbedFile creates an inline *Attachment from fileName so it can be
+// referenced from HTMLBody via a "cid:" URL, auto-detecting its
+// Content-Type from the file's contents and deriving a Content-ID from its
+// base filename. It also returns the *Attachment so that the user may set
+// additional fields, such as a custom ContentID.
+func (em *Email) EmbedFile(fileName string) (*Attachment, error) {
+	fileContents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	attln := strings.Split(fileName, "/")
+	baseName := attln[len(attln)-1]
+
+	att := &Attachment{
+		ContentType:        http.DetectContentType(fileContents),
+		ContentDisposition: "inline",
+		ContentID:          baseName,
+		FileName:           baseName,
+		Contents:           fileContents,
+	}
+	em.Attachments = append(em.Attachments, att)
+	return att, nil
+}
+
+// inlineAttachments returns the subset of em.Attachments embedded via
+// EmbedFile (or otherwise marked inline with a Content-ID).
+func (em *Email) inlineAttachments() []*Attachment {
+	var res []*Attachment
+	for _, a := range em.Attachments {
+		if a.isInline() {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
+// regularAttachments returns the subset of em.Attachments that are not
+// inline, e.g. those added via AttachFile.
+func (em *Email) regularAttachments() []*Attachment {
+	var res []*Attachment
+	for _, a := range em.Attachments {
+		if !a.isInline() {
+			res = append(res, a)
+		}
+	}
+	return res
+}
+
 // String returns the text representation of the Email, as it will be sent
 // over the wire.
 func (em *Email) String() string {
 	var fromline string
 	if em.FromName != "" {
-		fromline = fmt.Sprintf(`"%s" <%s>`, em.FromName, em.From)
+		fromline = fmt.Sprintf(`"%s" <%s>`, encodeHeaderValue(em.FromName), em.From)
 	} else {
 		fromline = em.From
 	}
 
 	var boundary string
+	regularAtt := em.regularAttachments()
 
 	if em.ContentType == "" {
-		if em.Body != "" && em.HTMLBody != "" {
+		switch {
+		case len(regularAtt) > 0:
+			em.ContentType = "multipart/mixed"
+		case em.Body != "" && em.HTMLBody != "":
 			em.ContentType = "multipart/alternative"
-		} else if em.HTMLBody != "" {
+		case em.HTMLBody != "" && len(em.inlineAttachments()) > 0:
+			em.ContentType = "multipart/related"
+		case em.HTMLBody != "":
 			em.ContentType = "text/html"
-		} else {
+		default:
 			em.ContentType = "text/plain"
 		}
 	}
@@ -210,23 +366,31 @@ func (em *Email) String() string {
 	if em.isMultipart() {
 		boundary = genBoundary()
 		m += fmt.Sprintf("; boundary=\"%s\"", boundary)
+	} else if em.ContentType == "text/plain" || em.ContentType == "text/html" {
+		// A flat, single-part message has no nested part to carry its own
+		// Content-Type, so the charset belongs on this top-level header.
+		m += fmt.Sprintf(`; charset="%s"`, em.Charset)
 	}
 	m += "\r\n"
 	m += "MIME-Version: 1.0\r\n"
-	m += fmt.Sprintf("From: %s\r\n", fromline)
+	m += foldHeader("From", fromline)
 	if em.Sender != "" {
-		m += fmt.Sprintf("Sender: %s\r\n", em.Sender)
+		m += foldHeader("Sender", em.Sender)
 	}
 	if len(em.ReplyTo) > 0 {
-		m += fmt.Sprintf("Reply-To: %s\r\n", strings.Join(em.ReplyTo, ", "))
+		m += foldHeader("Reply-To", strings.Join(em.ReplyTo, ", "))
 	}
-	m += fmt.Sprintf("To: %s\r\n", strings.Join(em.To, ", "))
+	m += foldHeader("To", strings.Join(em.To, ", "))
 	if len(em.CC) > 0 {
-		m += fmt.Sprintf("CC: %s\r\n", strings.Join(em.CC, ", "))
+		m += foldHeader("CC", strings.Join(em.CC, ", "))
 	}
-	m += fmt.Sprintf("Subject: %s\r\n", em.Subject)
+	m += foldHeader("Subject", encodeHeaderValue(em.Subject))
 
-	m += fmt.Sprintf("Date: %s\r\n", time.Now().Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	date := em.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	m += fmt.Sprintf("Date: %s\r\n", date.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
 
 	// Add priority headers only if they aren't blank
 	if em.XPriority != "" {
@@ -247,26 +411,57 @@ func (em *Email) String() string {
 	if em.HostName == "" {
 		em.HostName = "localhost"
 	}
-	m += fmt.Sprintf("Message-ID: <%s@%s>\r\n", GenID(), em.HostName)
+	msgID := em.MessageID
+	if msgID == "" {
+		msgID = fmt.Sprintf("%s@%s", GenID(), em.HostName)
+	}
+	m += fmt.Sprintf("Message-ID: <%s>\r\n", msgID)
 
 	// multipart emails must set multiple boundaries
 	if em.isMultipart() {
 		m += "\r\n--" + boundary + "\r\n"
 	}
 
-	if em.Body != "" && em.HTMLBody != "" && em.ContentType != "multipart/alternative" {
+	switch {
+	case em.Body != "" && em.HTMLBody != "" && em.ContentType != "multipart/alternative":
+		// The top-level ContentType is not multipart/alternative (typically
+		// multipart/mixed, set above for regular attachments or by the
+		// caller) while both bodies are present: nest them in their own
+		// multipart/alternative part.
 		b2 := genBoundary()
 		m += fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", b2)
+		m += "MIME-Version: 1.0\r\n\r\n"
 		m += "--" + b2 + "\r\n"
 		m += em.generateBody(b2)
-		m += em.generateHTML(b2)
+		m += em.generateHTMLPart(b2)
 		m = strings.TrimRight(m, "\r\n") + "--\r\n\r\n"
 		m += "--" + boundary + "\r\n"
-	} else {
-		m += em.generateBody(boundary)
+	case em.ContentType == "multipart/related":
+		// The top level is already the related wrapper: HTML plus its
+		// inline resources, with no plain-text alternative.
 		m += em.generateHTML(boundary)
+		m += em.generateAttachments(boundary, em.inlineAttachments())
+	case em.isMultipart():
+		m += em.generateBody(boundary)
+		m += em.generateHTMLPart(boundary)
+	default:
+		// A flat, single-part message (just Body or just HTMLBody, no
+		// attachments): the top-level header block above already carries
+		// Content-Type and MIME-Version, so only the Content-Transfer-
+		// Encoding header, the blank line, and the body itself remain.
+		body := em.Body
+		if body == "" {
+			body = em.HTMLBody
+		}
+		if isASCII(body) {
+			m += "Content-Transfer-Encoding: 7bit\r\n\r\n"
+			m += body + "\r\n"
+		} else {
+			m += "Content-Transfer-Encoding: quoted-printable\r\n\r\n"
+			m += encodeQuotedPrintable(body) + "\r\n"
+		}
 	}
-	m += em.generateAttachments(boundary)
+	m += em.generateAttachments(boundary, regularAtt)
 	if em.isMultipart() {
 		m = strings.TrimRight(m, "\r\n") + "--\r\n"
 	}
@@ -274,14 +469,38 @@ func (em *Email) String() string {
 	return m
 }
 
-// Send sends the Email.
+// WriteTo writes the Email's wire representation to w, satisfying
+// io.WriterTo so messages can be streamed out by a Dialer instead of being
+// fully materialized as a string first.
+func (em *Email) WriteTo(w io.Writer) (int64, error) {
+	n, err := io.WriteString(w, em.String())
+	return int64(n), err
+}
+
+// Send sends the Email by constructing a one-shot Dialer from em.Server,
+// em.Port, em.Username, em.Password, em.TLSPolicy, em.TLSConfig, and
+// em.AuthType.
 func (em *Email) Send() error {
-	toline := append(em.To, em.CC...)
-	toline = append(toline, em.BCC...)
-	auth := smtp.PlainAuth("", em.Username, em.Password, em.Server)
-	err := SendMail(em.Server+":"+em.Port, auth, em.From, toline, []byte(em.String()))
+	d := &Dialer{
+		Host:      em.Server,
+		Port:      em.Port,
+		Username:  em.Username,
+		Password:  em.Password,
+		TLSPolicy: em.TLSPolicy,
+		TLSConfig: em.TLSConfig,
+		AuthType:  em.AuthType,
+		LocalName: em.HostName,
+	}
+
+	sc, err := d.Dial()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer sc.Close()
+
+	toline := append([]string{}, em.To...)
+	toline = append(toline, em.CC...)
+	toline = append(toline, em.BCC...)
+
+	return sc.Send(em.From, toline, em)
 }